@@ -0,0 +1,216 @@
+// Package jobs holds background tasks that run independently of an incoming request, such
+// as keeping calendar push subscriptions alive and resyncing the cached availability they
+// back.
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"schej.it/server/db"
+	"schej.it/server/models"
+	"schej.it/server/services/calendar"
+)
+
+// renewBefore is how far ahead of a subscription's expiry we renew it
+const renewBefore = 24 * time.Hour
+
+// watchTTL is how long a single watch channel lasts before it must be renewed
+const watchTTL = 7 * 24 * time.Hour
+
+func callbackURL() string {
+	return os.Getenv("CALENDAR_WEBHOOK_URL") + "/webhooks/calendar"
+}
+
+// SubscribeCalendarAccount watches every sub-calendar on a newly-connected CalendarAccount
+// and inserts the resulting CalendarSubscription documents. This is what makes push sync
+// (or, for polling-only providers, ctag polling) start in the first place, so it must be
+// called wherever a CalendarAccount is first connected.
+func SubscribeCalendarAccount(account models.CalendarAccount, subCalendars map[string]models.SubCalendar) {
+	provider := calendar.GetCalendarProvider(account)
+
+	for calendarId := range subCalendars {
+		channelToken := uuid.NewString()
+		channelId, resourceId, expiry, err := provider.Watch(calendarId, callbackURL(), channelToken, watchTTL)
+		if err != nil {
+			fmt.Printf("SubscribeCalendarAccount: failed to watch %s for %s: %s\n", calendarId, account.Email, err)
+			continue
+		}
+
+		subscription := models.CalendarSubscription{
+			AccountEmail: account.Email,
+			CalendarType: account.CalendarType,
+			CalendarId:   calendarId,
+			ChannelId:    channelId,
+			ChannelToken: channelToken,
+			ResourceId:   resourceId,
+			Expiry:       expiry,
+		}
+		if _, err := db.CalendarSubscriptionsCollection.InsertOne(context.Background(), subscription); err != nil {
+			fmt.Printf("SubscribeCalendarAccount: failed to save subscription for %s: %s\n", calendarId, err)
+		}
+	}
+}
+
+// RefreshCalendarSubscriptions renews any CalendarSubscription expiring within renewBefore
+// and should be invoked on a recurring schedule (e.g. once an hour)
+func RefreshCalendarSubscriptions() {
+	cursor, err := db.CalendarSubscriptionsCollection.Find(context.Background(), bson.M{
+		"expiry": bson.M{"$lt": time.Now().Add(renewBefore)},
+	})
+	if err != nil {
+		fmt.Println("RefreshCalendarSubscriptions: failed to query expiring subscriptions:", err)
+		return
+	}
+
+	var subscriptions []models.CalendarSubscription
+	if err := cursor.All(context.Background(), &subscriptions); err != nil {
+		fmt.Println("RefreshCalendarSubscriptions: failed to decode expiring subscriptions:", err)
+		return
+	}
+
+	for _, subscription := range subscriptions {
+		if err := renewSubscription(subscription); err != nil {
+			fmt.Printf("RefreshCalendarSubscriptions: failed to renew subscription %s: %s\n", subscription.Id.Hex(), err)
+		}
+	}
+}
+
+func renewSubscription(subscription models.CalendarSubscription) error {
+	var account models.CalendarAccount
+	if err := db.CalendarAccountsCollection.FindOne(context.Background(), bson.M{
+		"email":        subscription.AccountEmail,
+		"calendarType": subscription.CalendarType,
+	}).Decode(&account); err != nil {
+		return fmt.Errorf("looking up calendar account: %w", err)
+	}
+
+	provider := calendar.GetCalendarProvider(account)
+	if err := provider.StopWatch(subscription.ChannelId, subscription.ResourceId); err != nil {
+		fmt.Printf("renewSubscription: failed to stop old channel for %s: %s\n", subscription.AccountEmail, err)
+	}
+
+	channelToken := uuid.NewString()
+	channelId, resourceId, expiry, err := provider.Watch(subscription.CalendarId, callbackURL(), channelToken, watchTTL)
+	if err != nil {
+		return fmt.Errorf("watching calendar: %w", err)
+	}
+
+	_, err = db.CalendarSubscriptionsCollection.UpdateByID(context.Background(), subscription.Id, bson.M{
+		"$set": bson.M{
+			"channelId":    channelId,
+			"channelToken": channelToken,
+			"resourceId":   resourceId,
+			"expiry":       expiry,
+		},
+	})
+	return err
+}
+
+// PollCalDAVSubscriptions checks every subscription backed by a provider with no push
+// support (CTagPoller) for a changed ctag, and triggers a resync for any that changed. It
+// should be invoked on a recurring schedule (e.g. every few minutes) since these providers
+// never call /webhooks/calendar themselves.
+func PollCalDAVSubscriptions() {
+	cursor, err := db.CalendarSubscriptionsCollection.Find(context.Background(), bson.M{
+		"calendarType": bson.M{"$in": []models.CalendarType{models.CalDAVCalendarType, models.AppleCalendarType}},
+	})
+	if err != nil {
+		fmt.Println("PollCalDAVSubscriptions: failed to query subscriptions:", err)
+		return
+	}
+
+	var subscriptions []models.CalendarSubscription
+	if err := cursor.All(context.Background(), &subscriptions); err != nil {
+		fmt.Println("PollCalDAVSubscriptions: failed to decode subscriptions:", err)
+		return
+	}
+
+	for _, subscription := range subscriptions {
+		if err := pollSubscription(subscription); err != nil {
+			fmt.Printf("PollCalDAVSubscriptions: failed to poll %s: %s\n", subscription.Id.Hex(), err)
+		}
+	}
+}
+
+func pollSubscription(subscription models.CalendarSubscription) error {
+	var account models.CalendarAccount
+	if err := db.CalendarAccountsCollection.FindOne(context.Background(), bson.M{
+		"email":        subscription.AccountEmail,
+		"calendarType": subscription.CalendarType,
+	}).Decode(&account); err != nil {
+		return fmt.Errorf("looking up calendar account: %w", err)
+	}
+
+	poller, ok := calendar.GetCalendarProvider(account).(calendar.CTagPoller)
+	if !ok {
+		return nil
+	}
+
+	ctag, err := poller.GetCTag(subscription.CalendarId)
+	if err != nil {
+		return fmt.Errorf("fetching ctag: %w", err)
+	}
+	if ctag == subscription.CTag {
+		return nil
+	}
+
+	if _, err := db.CalendarSubscriptionsCollection.UpdateByID(context.Background(), subscription.Id, bson.M{
+		"$set": bson.M{"ctag": ctag},
+	}); err != nil {
+		return fmt.Errorf("saving new ctag: %w", err)
+	}
+
+	subscription.CTag = ctag
+	ResyncCalendarSubscription(subscription)
+	return nil
+}
+
+// ResyncCalendarSubscription is called when a push notification arrives (or, for
+// polling-only providers, when PollCalDAVSubscriptions notices the ctag changed). It does a
+// full refetch of the window below and updates the cached availability for this calendar -
+// there's no incremental sync-token support wired up (CalendarProvider.GetCalendarEvents has
+// no way to pass one), so every resync re-fetches the whole window regardless of how much
+// actually changed.
+func ResyncCalendarSubscription(subscription models.CalendarSubscription) {
+	var account models.CalendarAccount
+	if err := db.CalendarAccountsCollection.FindOne(context.Background(), bson.M{
+		"email":        subscription.AccountEmail,
+		"calendarType": subscription.CalendarType,
+	}).Decode(&account); err != nil {
+		fmt.Println("ResyncCalendarSubscription: failed to look up calendar account:", err)
+		return
+	}
+
+	provider := calendar.GetCalendarProvider(account)
+
+	timeMin := time.Now().Add(-24 * time.Hour)
+	timeMax := time.Now().Add(90 * 24 * time.Hour)
+	events, err := provider.GetCalendarEvents(subscription.CalendarId, timeMin, timeMax)
+	if err != nil {
+		fmt.Println("ResyncCalendarSubscription: failed to fetch events:", err)
+		return
+	}
+
+	_, err = db.CalendarEventCacheCollection.UpdateOne(
+		context.Background(),
+		bson.M{"accountEmail": subscription.AccountEmail, "calendarId": subscription.CalendarId},
+		bson.M{"$set": bson.M{
+			"accountEmail": subscription.AccountEmail,
+			"calendarId":   subscription.CalendarId,
+			"events":       events,
+			"windowStart":  timeMin,
+			"windowEnd":    timeMax,
+			"updatedAt":    time.Now(),
+		}},
+		options.Update().SetUpsert(true),
+	)
+	if err != nil {
+		fmt.Println("ResyncCalendarSubscription: failed to update event cache:", err)
+	}
+}
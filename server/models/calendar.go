@@ -0,0 +1,74 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type CalendarType string
+
+const (
+	GoogleCalendarType CalendarType = "google"
+	AppleCalendarType  CalendarType = "apple"
+	CalDAVCalendarType CalendarType = "caldav"
+)
+
+// An account the user has connected in order to read events from one of their calendars
+type CalendarAccount struct {
+	UserId       primitive.ObjectID `json:"-" bson:"userId,omitempty"`
+	Email        string             `json:"email" bson:"email,omitempty"`
+	CalendarType CalendarType       `json:"calendarType" bson:"calendarType,omitempty"`
+
+	GoogleCalendarAuth *GoogleCalendarAuth `json:"-" bson:"googleCalendarAuth,omitempty"`
+	AppleCalendarAuth  *AppleCalendarAuth  `json:"-" bson:"appleCalendarAuth,omitempty"`
+	CalDAVCalendarAuth *CalDAVCalendarAuth `json:"-" bson:"calDAVCalendarAuth,omitempty"`
+
+	// Sub calendars belonging to this account, keyed by sub calendar id
+	SubCalendars map[string]SubCalendar `json:"subCalendars" bson:"subCalendars,omitempty"`
+}
+
+type GoogleCalendarAuth struct {
+	AccessToken  string    `json:"-" bson:"accessToken,omitempty"`
+	RefreshToken string    `json:"-" bson:"refreshToken,omitempty"`
+	Expiry       time.Time `json:"-" bson:"expiry,omitempty"`
+}
+
+type AppleCalendarAuth struct {
+	AppleId     string `json:"-" bson:"appleId,omitempty"`
+	AppPassword string `json:"-" bson:"appPassword,omitempty"`
+}
+
+// Auth information for a CalDAV account (Fastmail, Nextcloud, mailbox.org, etc.)
+type CalDAVCalendarAuth struct {
+	ServerURL   string `json:"-" bson:"serverUrl,omitempty"`
+	Username    string `json:"-" bson:"username,omitempty"`
+	AppPassword string `json:"-" bson:"appPassword,omitempty"`
+}
+
+// A single calendar belonging to a CalendarAccount (e.g. "Work", "Personal")
+type SubCalendar struct {
+	Id      string `json:"id" bson:"id,omitempty"`
+	Name    string `json:"name" bson:"name,omitempty"`
+	Color   string `json:"color" bson:"color,omitempty"`
+	Enabled *bool  `json:"enabled" bson:"enabled,omitempty"`
+}
+
+// An event read from one of the user's connected calendars
+type CalendarEvent struct {
+	Summary   string             `json:"summary" bson:"summary,omitempty"`
+	StartDate primitive.DateTime `json:"startDate" bson:"startDate,omitempty"`
+	EndDate   primitive.DateTime `json:"endDate" bson:"endDate,omitempty"`
+}
+
+// Options controlling how calendar availability is factored into a response
+type CalendarOptions struct {
+	// Whether time blocked off by a calendar event should count as "if needed" rather than fully busy
+	TentativeIsIfNeeded *bool `json:"tentativeIsIfNeeded" bson:"tentativeIsIfNeeded,omitempty"`
+}
+
+// A single busy interval surfaced by the /user/freebusy and /events/:id/freebusy endpoints
+type FreeBusyBlock struct {
+	Start primitive.DateTime `json:"start"`
+	End   primitive.DateTime `json:"end"`
+}
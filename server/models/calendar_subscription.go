@@ -0,0 +1,43 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// A watch channel schej.it has registered with a calendar provider so that it's notified
+// of changes instead of having to poll. For providers that don't support push (CalDAV),
+// this instead tracks the collection's ctag so a background job can detect changes itself.
+type CalendarSubscription struct {
+	Id primitive.ObjectID `json:"_id" bson:"_id,omitempty"`
+
+	AccountEmail string       `json:"accountEmail" bson:"accountEmail,omitempty"`
+	CalendarType CalendarType `json:"calendarType" bson:"calendarType,omitempty"`
+	CalendarId   string       `json:"calendarId" bson:"calendarId,omitempty"`
+
+	ChannelId    string `json:"-" bson:"channelId,omitempty"`
+	ChannelToken string `json:"-" bson:"channelToken,omitempty"`
+	ResourceId   string `json:"-" bson:"resourceId,omitempty"`
+
+	// CTag is CalDAV's getctag, used by jobs.PollCalDAVSubscriptions to detect that a
+	// collection changed. Resyncing itself is always a full refetch of the window in
+	// jobs.ResyncCalendarSubscription - there's no equivalent incremental token wired up
+	// for Google, so CTag only gates *whether* to resync, not what to refetch.
+	CTag string `json:"-" bson:"ctag,omitempty"`
+
+	Expiry time.Time `json:"expiry" bson:"expiry,omitempty"`
+}
+
+// CalendarEventCache is the last events jobs.ResyncCalendarSubscription fetched for a
+// subscribed calendar, keyed by (AccountEmail, CalendarId). WindowStart/WindowEnd record the
+// range that was fetched, so a reader can tell whether the cache actually covers the range
+// it needs before trusting it instead of hitting the provider live.
+type CalendarEventCache struct {
+	AccountEmail string          `bson:"accountEmail,omitempty"`
+	CalendarId   string          `bson:"calendarId,omitempty"`
+	Events       []CalendarEvent `bson:"events,omitempty"`
+	WindowStart  time.Time       `bson:"windowStart,omitempty"`
+	WindowEnd    time.Time       `bson:"windowEnd,omitempty"`
+	UpdatedAt    time.Time       `bson:"updatedAt,omitempty"`
+}
@@ -0,0 +1,269 @@
+package routes
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/emersion/go-ical"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"schej.it/server/db"
+	"schej.it/server/middleware"
+	"schej.it/server/models"
+	"schej.it/server/services/calendar"
+	"schej.it/server/services/freebusy"
+	"schej.it/server/utils"
+)
+
+func InitEvents(router *gin.Engine) {
+	eventsRouter := router.Group("/events")
+
+	eventsRouter.GET("/:id/calendar.ics", getEventCalendar)
+	eventsRouter.GET("/:id/calendar-url", middleware.AuthRequired(), getEventCalendarURL)
+	eventsRouter.POST("/:id/freebusy", postEventFreeBusy)
+}
+
+// @Summary Gets an ICS representation of an event, suitable for subscribing from a calendar app
+// @Description Renders the event's scheduled time (or, if not yet scheduled, its candidate
+// @Description dates as tentative holds) as an RFC 5545 VCALENDAR. Access is granted only by a
+// @Description signed `token` query param (a session alone is not enough), so calendar apps can
+// @Description subscribe via webcal:// without logging in.
+// @Tags events
+// @Produce text/calendar
+// @Param token query string true "Signed token authorizing access without a session"
+// @Success 200 {string} string "An RFC 5545 VCALENDAR"
+// @Router /events/{id}/calendar.ics [get]
+func getEventCalendar(c *gin.Context) {
+	eventId := c.Param("id")
+
+	event, err := lookupEvent(eventId)
+	if err != nil {
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+
+	token := c.Query("token")
+	if !utils.VerifyEventICSToken(token, event.GetId()) {
+		c.AbortWithStatus(http.StatusUnauthorized)
+		return
+	}
+
+	cal := buildEventICS(event)
+
+	c.Header("Content-Type", "text/calendar; charset=utf-8")
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.ics"`, event.GetId()))
+	if err := ical.NewEncoder(c.Writer).Encode(cal); err != nil {
+		c.AbortWithStatus(http.StatusInternalServerError)
+	}
+}
+
+// @Summary Gets a signed webcal:// URL for subscribing to an event's calendar.ics feed
+// @Description Mints a token granting access to this event's feed without a session, so it
+// @Description can be handed to a calendar app (Apple Calendar/Google Calendar/Outlook).
+// @Tags events
+// @Produce json
+// @Success 200 {object} object "{ url: string }"
+// @Router /events/{id}/calendar-url [get]
+func getEventCalendarURL(c *gin.Context) {
+	eventId := c.Param("id")
+
+	event, err := lookupEvent(eventId)
+	if err != nil {
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+
+	token := utils.GenerateEventICSToken(event.GetId())
+	apiBaseURL := strings.TrimPrefix(strings.TrimPrefix(os.Getenv("API_BASE_URL"), "https://"), "http://")
+	webcalURL := "webcal://" + apiBaseURL + fmt.Sprintf("/events/%s/calendar.ics?token=%s", event.GetId(), token)
+
+	c.JSON(http.StatusOK, gin.H{"url": webcalURL})
+}
+
+// buildEventICS renders event as an RFC 5545 VCALENDAR
+func buildEventICS(event *models.Event) *ical.Calendar {
+	cal := ical.NewCalendar()
+	cal.Props.SetText(ical.PropVersion, "2.0")
+	cal.Props.SetText(ical.PropProductID, "-//schej.it//schej.it//EN")
+	cal.Props.SetText(ical.PropCalendarScale, "GREGORIAN")
+
+	if event.ScheduledEvent != nil {
+		cal.Children = append(cal.Children, scheduledVEVENT(event).Component)
+	} else {
+		for i, date := range event.Dates {
+			cal.Children = append(cal.Children, tentativeVEVENT(event, i, date).Component)
+		}
+	}
+
+	return cal
+}
+
+// scheduledVEVENT renders the single VEVENT for an event that has been finalized
+func scheduledVEVENT(event *models.Event) *ical.Event {
+	scheduledEvent := event.ScheduledEvent
+
+	vevent := ical.NewEvent()
+	vevent.Props.SetText(ical.PropUID, event.GetId()+"@schej.it")
+	vevent.Props.SetText(ical.PropSummary, event.Name)
+	vevent.Props.SetDateTime(ical.PropDateTimeStart, scheduledEvent.StartDate.Time())
+	vevent.Props.SetDateTime(ical.PropDateTimeEnd, scheduledEvent.EndDate.Time())
+
+	var owner models.User
+	if db.UsersCollection.FindOne(context.Background(), bson.M{"_id": event.OwnerId}).Decode(&owner) == nil {
+		vevent.Props.SetText(ical.PropOrganizer, "mailto:"+owner.Email)
+	}
+
+	if event.Attendees != nil {
+		for _, attendee := range *event.Attendees {
+			prop := ical.NewProp(ical.PropAttendee)
+			prop.Value = "mailto:" + attendee.Email
+			prop.Params.Set(ical.ParamParticipationStatus, partstatFor(attendee))
+			vevent.Props.Add(prop)
+		}
+	}
+
+	return vevent
+}
+
+// tentativeVEVENT renders a single candidate date as a transparent, tentative hold so it
+// shows up on the subscriber's calendar without blocking their availability
+func tentativeVEVENT(event *models.Event, index int, date primitive.DateTime) *ical.Event {
+	vevent := ical.NewEvent()
+	vevent.Props.SetText(ical.PropUID, fmt.Sprintf("%s-%d@schej.it", event.GetId(), index))
+	vevent.Props.SetText(ical.PropSummary, "[tentative] "+event.Name)
+	vevent.Props.SetText(ical.PropTransparency, "TRANSPARENT")
+
+	start := date.Time()
+	duration := time.Hour
+	if event.Duration != nil {
+		duration = time.Duration(*event.Duration * float32(time.Hour))
+	}
+	vevent.Props.SetDateTime(ical.PropDateTimeStart, start)
+	vevent.Props.SetDateTime(ical.PropDateTimeEnd, start.Add(duration))
+
+	return vevent
+}
+
+// partstatFor derives an iCalendar PARTSTAT value from an attendee's response
+func partstatFor(attendee models.Attendee) string {
+	if attendee.Declined != nil && *attendee.Declined {
+		return "DECLINED"
+	}
+	return "NEEDS-ACTION"
+}
+
+// lookupEvent finds an event by its short id or mongo ObjectID, mirroring models.Event.GetId
+func lookupEvent(eventId string) (*models.Event, error) {
+	filter := bson.M{"shortId": eventId}
+	if objectId, err := primitive.ObjectIDFromHex(eventId); err == nil {
+		filter = bson.M{"_id": objectId}
+	}
+
+	var event models.Event
+	if err := db.EventsCollection.FindOne(context.Background(), filter).Decode(&event); err != nil {
+		return nil, err
+	}
+	return &event, nil
+}
+
+// @Summary Gets the windows of time within an event's candidate dates when every responder
+// @Summary who opted into calendar availability is free
+// @Description For each candidate date/duration slot, fetches every opted-in responder's busy
+// @Description blocks within that slot, inverts them into free blocks, and intersects across
+// @Description responders to find the portions of the slot everyone is free. Slots are kept
+// @Description separate so a free window is never reported spanning dates that were never
+// @Description actually candidates (e.g. the gap between a Monday and a Friday candidate).
+// @Tags events
+// @Produce json
+// @Success 200 {object} object "{ free: []models.FreeBusyBlock }"
+// @Router /events/{id}/freebusy [post]
+func postEventFreeBusy(c *gin.Context) {
+	eventId := c.Param("id")
+
+	event, err := lookupEvent(eventId)
+	if err != nil {
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+
+	slots := candidateSlots(event)
+	if len(slots) == 0 {
+		c.JSON(http.StatusOK, gin.H{"free": []models.FreeBusyBlock{}})
+		return
+	}
+
+	free := make([]freebusy.Block, 0)
+	for _, slot := range slots {
+		freeSets := make([][]freebusy.Block, 0)
+		for _, response := range event.Responses {
+			if response.UseCalendarAvailability == nil || !*response.UseCalendarAvailability || response.EnabledCalendars == nil {
+				continue
+			}
+
+			busy := busyBlocksForEnabledCalendars(response.UserId, *response.EnabledCalendars, slot.Start, slot.End)
+			freeSets = append(freeSets, freebusy.Invert(busy, slot.Start, slot.End))
+		}
+
+		free = append(free, freebusy.Intersect(freeSets)...)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"free": freeBusyBlocksFromTimeBlocks(freebusy.Merge(free))})
+}
+
+// busyBlocksForEnabledCalendars fetches busy blocks for the sub-calendars a single responder
+// enabled, keyed by the email of the calendar account they belong to. Accounts are scoped to
+// userId so one responder's EnabledCalendars can never pull in another user's calendar data.
+func busyBlocksForEnabledCalendars(userId primitive.ObjectID, enabledCalendars map[string][]string, windowStart time.Time, windowEnd time.Time) []freebusy.Block {
+	busy := make([]freebusy.Block, 0)
+
+	for email, subCalendarIds := range enabledCalendars {
+		var account models.CalendarAccount
+		err := db.CalendarAccountsCollection.FindOne(context.Background(), bson.M{
+			"userId": userId,
+			"email":  email,
+		}).Decode(&account)
+		if err != nil {
+			continue
+		}
+
+		for _, calendarId := range subCalendarIds {
+			events, err := calendar.EventsForCalendar(account, calendarId, windowStart, windowEnd)
+			if err != nil {
+				continue
+			}
+			for _, event := range events {
+				busy = append(busy, freebusy.Block{Start: event.StartDate.Time(), End: event.EndDate.Time()})
+			}
+		}
+	}
+
+	return busy
+}
+
+// candidateSlots returns the [date, date+duration] window for every one of an event's
+// candidate dates. Each slot is kept separate (rather than collapsed into one bounding
+// window) so free/busy is never computed over a stretch of time that was never actually
+// a candidate.
+func candidateSlots(event *models.Event) []freebusy.Block {
+	if len(event.Dates) == 0 {
+		return nil
+	}
+
+	duration := time.Hour
+	if event.Duration != nil {
+		duration = time.Duration(*event.Duration * float32(time.Hour))
+	}
+
+	slots := make([]freebusy.Block, len(event.Dates))
+	for i, date := range event.Dates {
+		start := date.Time()
+		slots[i] = freebusy.Block{Start: start, End: start.Add(duration)}
+	}
+
+	return slots
+}
@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"sync"
 	"time"
 
 	"github.com/gin-contrib/sessions"
@@ -12,8 +13,11 @@ import (
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"schej.it/server/db"
+	"schej.it/server/jobs"
 	"schej.it/server/middleware"
 	"schej.it/server/models"
+	"schej.it/server/services/calendar"
+	"schej.it/server/services/freebusy"
 	"schej.it/server/utils"
 )
 
@@ -24,6 +28,8 @@ func InitUser(router *gin.Engine) {
 	userRouter.GET("/profile", getProfile)
 	userRouter.GET("/events", getEvents)
 	userRouter.GET("/calendar", getCalendar)
+	userRouter.GET("/freebusy", getFreeBusy)
+	userRouter.POST("/calendar-accounts/caldav", postCalDAVAccount)
 }
 
 // @Summary Gets the user's profile
@@ -144,3 +150,170 @@ func getCalendar(c *gin.Context) {
 
 	c.JSON(http.StatusOK, calendarEvents)
 }
+
+// @Summary Gets merged busy blocks across all of the user's connected calendars
+// @Description Iterates every calendar account the user has connected, fetches events from
+// @Description all of their enabled sub-calendars concurrently, and merges the results into
+// @Description a single sorted list of busy blocks. A per-account error is reported instead
+// @Description of failing the whole request if one provider errors out.
+// @Tags user
+// @Produce json
+// @Param timeMin query string true "Lower bound for the freebusy window"
+// @Param timeMax query string true "Upper bound for the freebusy window"
+// @Success 200 {object} object "{ busy: []models.FreeBusyBlock, errors: map[string]string }"
+// @Router /user/freebusy [get]
+func getFreeBusy(c *gin.Context) {
+	payload := struct {
+		TimeMin time.Time `form:"timeMin" binding:"required"`
+		TimeMax time.Time `form:"timeMax" binding:"required"`
+	}{}
+	if err := c.Bind(&payload); err != nil {
+		return
+	}
+	session := sessions.Default(c)
+
+	var accounts []models.CalendarAccount
+	cursor, err := db.CalendarAccountsCollection.Find(context.Background(), bson.M{
+		"userId": utils.GetUserId(session),
+	})
+	if err != nil {
+		panic(err)
+	}
+	if err := cursor.All(context.Background(), &accounts); err != nil {
+		panic(err)
+	}
+
+	busy, errors := busyBlocksForAccounts(accounts, payload.TimeMin, payload.TimeMax)
+
+	c.JSON(http.StatusOK, gin.H{
+		"busy":   freeBusyBlocksFromTimeBlocks(freebusy.Merge(busy)),
+		"errors": errors,
+	})
+}
+
+// busyBlocksForAccounts concurrently fetches busy blocks from every enabled sub-calendar of
+// every given account (preferring each sub-calendar's event cache over a live provider call,
+// via calendar.EventsForCalendar), returning the unmerged blocks plus a map of account email
+// to error message for any account that failed
+func busyBlocksForAccounts(accounts []models.CalendarAccount, timeMin time.Time, timeMax time.Time) ([]freebusy.Block, map[string]string) {
+	type accountResult struct {
+		email  string
+		blocks []freebusy.Block
+		err    error
+	}
+
+	results := make(chan accountResult, len(accounts))
+	var wg sync.WaitGroup
+	for _, account := range accounts {
+		wg.Add(1)
+		go func(account models.CalendarAccount) {
+			defer wg.Done()
+
+			provider := calendar.GetCalendarProvider(account)
+			subCalendars, err := provider.GetCalendarList()
+			if err != nil {
+				results <- accountResult{email: account.Email, err: err}
+				return
+			}
+
+			blocks := make([]freebusy.Block, 0)
+			for calendarId, subCalendar := range subCalendars {
+				if subCalendar.Enabled != nil && !*subCalendar.Enabled {
+					continue
+				}
+
+				events, err := calendar.EventsForCalendar(account, calendarId, timeMin, timeMax)
+				if err != nil {
+					results <- accountResult{email: account.Email, err: err}
+					return
+				}
+				for _, event := range events {
+					blocks = append(blocks, freebusy.Block{Start: event.StartDate.Time(), End: event.EndDate.Time()})
+				}
+			}
+
+			results <- accountResult{email: account.Email, blocks: blocks}
+		}(account)
+	}
+	wg.Wait()
+	close(results)
+
+	busy := make([]freebusy.Block, 0)
+	errs := make(map[string]string)
+	for result := range results {
+		if result.err != nil {
+			errs[result.email] = result.err.Error()
+			continue
+		}
+		busy = append(busy, result.blocks...)
+	}
+
+	return busy, errs
+}
+
+// freeBusyBlocksFromTimeBlocks converts internal freebusy.Block values to the
+// models.FreeBusyBlock shape returned to clients
+func freeBusyBlocksFromTimeBlocks(blocks []freebusy.Block) []models.FreeBusyBlock {
+	freeBusyBlocks := make([]models.FreeBusyBlock, len(blocks))
+	for i, block := range blocks {
+		freeBusyBlocks[i] = models.FreeBusyBlock{
+			Start: primitive.NewDateTimeFromTime(block.Start),
+			End:   primitive.NewDateTimeFromTime(block.End),
+		}
+	}
+	return freeBusyBlocks
+}
+
+// caldavAccountPayload is the client-facing shape of a postCalDAVAccount request. It exists
+// because models.CalDAVCalendarAuth's fields are all tagged json:"-" (it's only ever meant to
+// be populated server-side and stored, never bound directly from a request body).
+type caldavAccountPayload struct {
+	ServerURL   string `json:"serverUrl" binding:"required"`
+	Username    string `json:"username" binding:"required"`
+	AppPassword string `json:"appPassword" binding:"required"`
+}
+
+// @Summary Connects a CalDAV calendar account (Fastmail, Nextcloud, mailbox.org, etc.)
+// @Description Verifies the given credentials by discovering the account's calendars, saves
+// @Description the account, and subscribes to every discovered sub-calendar so its
+// @Description availability stays fresh without polling on every /user/freebusy request.
+// @Tags user
+// @Accept json
+// @Produce json
+// @Param payload body caldavAccountPayload true "CalDAV server URL, username, and app password"
+// @Success 200 {object} models.CalendarAccount
+// @Router /user/calendar-accounts/caldav [post]
+func postCalDAVAccount(c *gin.Context) {
+	var payload caldavAccountPayload
+	if err := c.BindJSON(&payload); err != nil {
+		return
+	}
+	session := sessions.Default(c)
+
+	auth := models.CalDAVCalendarAuth{
+		ServerURL:   payload.ServerURL,
+		Username:    payload.Username,
+		AppPassword: payload.AppPassword,
+	}
+	account := models.CalendarAccount{
+		UserId:             utils.GetUserId(session),
+		Email:              auth.Username,
+		CalendarType:       models.CalDAVCalendarType,
+		CalDAVCalendarAuth: &auth,
+	}
+
+	subCalendars, err := calendar.GetCalendarProvider(account).GetCalendarList()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("could not connect to CalDAV server: %s", err)})
+		return
+	}
+	account.SubCalendars = subCalendars
+
+	if _, err := db.CalendarAccountsCollection.InsertOne(context.Background(), account); err != nil {
+		panic(err)
+	}
+
+	go jobs.SubscribeCalendarAccount(account, subCalendars)
+
+	c.JSON(http.StatusOK, account)
+}
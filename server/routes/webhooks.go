@@ -0,0 +1,53 @@
+package routes
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"schej.it/server/db"
+	"schej.it/server/jobs"
+	"schej.it/server/models"
+)
+
+func InitWebhooks(router *gin.Engine) {
+	webhooksRouter := router.Group("/webhooks")
+
+	webhooksRouter.POST("/calendar", postCalendarWebhook)
+}
+
+// @Summary Receives a calendar change push notification
+// @Description Called by a calendar provider (currently Google) when a watched calendar
+// @Description changes. Not intended to be called directly by clients.
+// @Tags webhooks
+// @Router /webhooks/calendar [post]
+func postCalendarWebhook(c *gin.Context) {
+	channelId := c.GetHeader("X-Goog-Channel-ID")
+	resourceId := c.GetHeader("X-Goog-Resource-ID")
+	channelToken := c.GetHeader("X-Goog-Channel-Token")
+	if channelId == "" || resourceId == "" {
+		// Not a notification we recognize; acknowledge anyway so the provider doesn't retry
+		c.Status(http.StatusOK)
+		return
+	}
+
+	var subscription models.CalendarSubscription
+	err := db.CalendarSubscriptionsCollection.FindOne(context.Background(), bson.M{
+		"channelId":  channelId,
+		"resourceId": resourceId,
+	}).Decode(&subscription)
+	if err != nil {
+		c.Status(http.StatusOK)
+		return
+	}
+
+	if subscription.ChannelToken != channelToken {
+		c.AbortWithStatus(http.StatusForbidden)
+		return
+	}
+
+	go jobs.ResyncCalendarSubscription(subscription)
+
+	c.Status(http.StatusOK)
+}
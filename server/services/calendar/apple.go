@@ -0,0 +1,49 @@
+package calendar
+
+import (
+	"time"
+
+	"schej.it/server/models"
+)
+
+// icloudCalDAVServerURL is Apple's well-known CalDAV entry point; the real per-user server
+// is discovered from here the same way any other CalDAV principal is
+const icloudCalDAVServerURL = "https://caldav.icloud.com"
+
+// AppleCalendar implements CalendarProvider for a user's iCloud account. iCloud calendars
+// are served over CalDAV (authenticated with an Apple ID + app-specific password), so this
+// just adapts AppleCalendarAuth into a CalDAVCalendar and delegates to it.
+type AppleCalendar struct {
+	models.AppleCalendarAuth
+}
+
+func (a *AppleCalendar) caldav() *CalDAVCalendar {
+	return &CalDAVCalendar{
+		CalDAVCalendarAuth: models.CalDAVCalendarAuth{
+			ServerURL:   icloudCalDAVServerURL,
+			Username:    a.AppleId,
+			AppPassword: a.AppPassword,
+		},
+	}
+}
+
+func (a *AppleCalendar) GetCalendarList() (map[string]models.SubCalendar, error) {
+	return a.caldav().GetCalendarList()
+}
+
+func (a *AppleCalendar) GetCalendarEvents(calendarId string, timeMin time.Time, timeMax time.Time) ([]models.CalendarEvent, error) {
+	return a.caldav().GetCalendarEvents(calendarId, timeMin, timeMax)
+}
+
+func (a *AppleCalendar) Watch(calendarId string, callbackURL string, channelToken string, ttl time.Duration) (channelId string, resourceId string, expiry time.Time, err error) {
+	return a.caldav().Watch(calendarId, callbackURL, channelToken, ttl)
+}
+
+func (a *AppleCalendar) StopWatch(channelId string, resourceId string) error {
+	return a.caldav().StopWatch(channelId, resourceId)
+}
+
+// GetCTag satisfies calendar.CTagPoller; iCloud is polled just like any other CalDAV server
+func (a *AppleCalendar) GetCTag(calendarId string) (string, error) {
+	return a.caldav().GetCTag(calendarId)
+}
@@ -0,0 +1,41 @@
+package calendar
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"schej.it/server/db"
+	"schej.it/server/models"
+)
+
+// EventsForCalendar returns calendarId's events in [timeMin, timeMax], preferring the cache
+// jobs.ResyncCalendarSubscription maintains for subscribed calendars over hitting the
+// provider live. It falls back to a live GetCalendarEvents call if there's no cached entry
+// yet (e.g. the account was just connected and the initial Watch hasn't resynced it) or the
+// cached window doesn't cover the requested range.
+func EventsForCalendar(account models.CalendarAccount, calendarId string, timeMin time.Time, timeMax time.Time) ([]models.CalendarEvent, error) {
+	var cached models.CalendarEventCache
+	err := db.CalendarEventCacheCollection.FindOne(context.Background(), bson.M{
+		"accountEmail": account.Email,
+		"calendarId":   calendarId,
+	}).Decode(&cached)
+
+	if err == nil && !cached.WindowStart.After(timeMin) && !cached.WindowEnd.Before(timeMax) {
+		return eventsInRange(cached.Events, timeMin, timeMax), nil
+	}
+
+	return GetCalendarProvider(account).GetCalendarEvents(calendarId, timeMin, timeMax)
+}
+
+// eventsInRange filters cached events down to the ones that overlap [timeMin, timeMax],
+// matching what a live GetCalendarEvents call for that range would have returned
+func eventsInRange(events []models.CalendarEvent, timeMin time.Time, timeMax time.Time) []models.CalendarEvent {
+	filtered := make([]models.CalendarEvent, 0, len(events))
+	for _, event := range events {
+		if event.StartDate.Time().Before(timeMax) && event.EndDate.Time().After(timeMin) {
+			filtered = append(filtered, event)
+		}
+	}
+	return filtered
+}
@@ -0,0 +1,389 @@
+package calendar
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/emersion/go-ical"
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"schej.it/server/models"
+	"schej.it/server/services/calendar/recurrence"
+)
+
+// CalDAVCalendar implements CalendarProvider for any standards-compliant CalDAV
+// server (Fastmail, Nextcloud, mailbox.org, etc.)
+type CalDAVCalendar struct {
+	models.CalDAVCalendarAuth
+}
+
+// multistatus mirrors the subset of a CalDAV PROPFIND/REPORT response that we care about
+type multistatus struct {
+	XMLName   xml.Name   `xml:"DAV: multistatus"`
+	Responses []response `xml:"response"`
+}
+
+type response struct {
+	Href     string   `xml:"href"`
+	PropStat propstat `xml:"propstat"`
+}
+
+type propstat struct {
+	Prop prop `xml:"prop"`
+}
+
+type prop struct {
+	CurrentUserPrincipal href   `xml:"DAV: current-user-principal"`
+	CalendarHomeSet      href   `xml:"urn:ietf:params:xml:ns:caldav calendar-home-set"`
+	DisplayName          string `xml:"DAV: displayname"`
+	CalendarColor        string `xml:"http://apple.com/ns/ical/ calendar-color"`
+	CalendarData         string `xml:"urn:ietf:params:xml:ns:caldav calendar-data"`
+	GetCTag              string `xml:"http://calendarserver.org/ns/ getctag"`
+	ResourceType         struct {
+		Calendar *struct{} `xml:"urn:ietf:params:xml:ns:caldav calendar"`
+	} `xml:"DAV: resourcetype"`
+}
+
+type href struct {
+	Href string `xml:"href"`
+}
+
+// propfind issues a PROPFIND request against url with the given depth and request body,
+// returning the parsed multistatus response
+func (c *CalDAVCalendar) propfind(url string, depth string, body string) (*multistatus, error) {
+	req, err := http.NewRequest("PROPFIND", url, strings.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.SetBasicAuth(c.Username, c.AppPassword)
+	req.Header.Set("Content-Type", "application/xml; charset=utf-8")
+	req.Header.Set("Depth", depth)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 207 {
+		respBody, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("caldav: unexpected status %d from PROPFIND %s: %s", resp.StatusCode, url, respBody)
+	}
+
+	ms := &multistatus{}
+	if err := xml.NewDecoder(resp.Body).Decode(ms); err != nil {
+		return nil, err
+	}
+	return ms, nil
+}
+
+// resolve turns a (possibly relative) href returned by the server into an absolute URL
+// rooted at the CalDAV server's base URL
+func (c *CalDAVCalendar) resolve(href string) string {
+	if strings.HasPrefix(href, "http://") || strings.HasPrefix(href, "https://") {
+		return href
+	}
+
+	base := c.ServerURL
+	if idx := strings.Index(base, "://"); idx != -1 {
+		if slash := strings.Index(base[idx+3:], "/"); slash != -1 {
+			base = base[:idx+3+slash]
+		}
+	}
+	return strings.TrimRight(base, "/") + href
+}
+
+// GetCalendarList discovers the user's calendar home set and returns the calendar
+// collections within it, keyed by their href
+func (c *CalDAVCalendar) GetCalendarList() (map[string]models.SubCalendar, error) {
+	principalRes, err := c.propfind(c.ServerURL, "0", `<?xml version="1.0" encoding="utf-8"?>
+<D:propfind xmlns:D="DAV:">
+  <D:prop><D:current-user-principal/></D:prop>
+</D:propfind>`)
+	if err != nil {
+		return nil, fmt.Errorf("caldav: discovering current-user-principal: %w", err)
+	}
+	if len(principalRes.Responses) == 0 {
+		return nil, fmt.Errorf("caldav: server returned no current-user-principal")
+	}
+	principalUrl := c.resolve(principalRes.Responses[0].PropStat.Prop.CurrentUserPrincipal.Href)
+
+	homeSetRes, err := c.propfind(principalUrl, "0", `<?xml version="1.0" encoding="utf-8"?>
+<D:propfind xmlns:D="DAV:" xmlns:C="urn:ietf:params:xml:ns:caldav">
+  <D:prop><C:calendar-home-set/></D:prop>
+</D:propfind>`)
+	if err != nil {
+		return nil, fmt.Errorf("caldav: discovering calendar-home-set: %w", err)
+	}
+	if len(homeSetRes.Responses) == 0 {
+		return nil, fmt.Errorf("caldav: server returned no calendar-home-set")
+	}
+	homeSetUrl := c.resolve(homeSetRes.Responses[0].PropStat.Prop.CalendarHomeSet.Href)
+
+	collectionsRes, err := c.propfind(homeSetUrl, "1", `<?xml version="1.0" encoding="utf-8"?>
+<D:propfind xmlns:D="DAV:" xmlns:IC="http://apple.com/ns/ical/">
+  <D:prop>
+    <D:resourcetype/>
+    <D:displayname/>
+    <IC:calendar-color/>
+  </D:prop>
+</D:propfind>`)
+	if err != nil {
+		return nil, fmt.Errorf("caldav: enumerating calendar collections: %w", err)
+	}
+
+	subCalendars := make(map[string]models.SubCalendar)
+	for _, res := range collectionsRes.Responses {
+		if res.PropStat.Prop.ResourceType.Calendar == nil {
+			continue
+		}
+
+		subCalendars[res.Href] = models.SubCalendar{
+			Id:    res.Href,
+			Name:  res.PropStat.Prop.DisplayName,
+			Color: res.PropStat.Prop.CalendarColor,
+		}
+	}
+
+	return subCalendars, nil
+}
+
+// GetCalendarEvents issues a calendar-query REPORT scoped to VEVENTs within
+// [timeMin, timeMax] and parses the resulting VCALENDAR bodies
+func (c *CalDAVCalendar) GetCalendarEvents(calendarId string, timeMin time.Time, timeMax time.Time) ([]models.CalendarEvent, error) {
+	const timeFormat = "20060102T150405Z"
+	body := fmt.Sprintf(`<?xml version="1.0" encoding="utf-8"?>
+<C:calendar-query xmlns:D="DAV:" xmlns:C="urn:ietf:params:xml:ns:caldav">
+  <D:prop>
+    <C:calendar-data/>
+  </D:prop>
+  <C:filter>
+    <C:comp-filter name="VCALENDAR">
+      <C:comp-filter name="VEVENT">
+        <C:time-range start="%s" end="%s"/>
+      </C:comp-filter>
+    </C:comp-filter>
+  </C:filter>
+</C:calendar-query>`, timeMin.UTC().Format(timeFormat), timeMax.UTC().Format(timeFormat))
+
+	url := c.resolve(calendarId)
+	req, err := http.NewRequest("REPORT", url, strings.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.SetBasicAuth(c.Username, c.AppPassword)
+	req.Header.Set("Content-Type", "application/xml; charset=utf-8")
+	req.Header.Set("Depth", "1")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 207 {
+		respBody, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("caldav: unexpected status %d from REPORT %s: %s", resp.StatusCode, url, respBody)
+	}
+
+	ms := &multistatus{}
+	if err := xml.NewDecoder(resp.Body).Decode(ms); err != nil {
+		return nil, err
+	}
+
+	calendarEvents := make([]models.CalendarEvent, 0)
+	for _, res := range ms.Responses {
+		if res.PropStat.Prop.CalendarData == "" {
+			continue
+		}
+
+		cal, err := ical.NewDecoder(bytes.NewReader([]byte(res.PropStat.Prop.CalendarData))).Decode()
+		if err != nil {
+			return nil, fmt.Errorf("caldav: parsing calendar-data for %s: %w", res.Href, err)
+		}
+
+		events, err := expandVEVENTs(cal.Events(), timeMin, timeMax)
+		if err != nil {
+			return nil, fmt.Errorf("caldav: expanding events for %s: %w", res.Href, err)
+		}
+		calendarEvents = append(calendarEvents, events...)
+	}
+
+	return calendarEvents, nil
+}
+
+// expandVEVENTs groups a VCALENDAR's VEVENTs by UID (a master event plus any
+// RECURRENCE-ID overrides) and expands each group into concrete occurrences
+// within [timeMin, timeMax]
+func expandVEVENTs(icalEvents []ical.Event, timeMin time.Time, timeMax time.Time) ([]models.CalendarEvent, error) {
+	type group struct {
+		master    *ical.Event
+		overrides []ical.Event
+	}
+	groups := make(map[string]*group)
+	var order []string
+
+	for i := range icalEvents {
+		event := icalEvents[i]
+		uid, err := event.Props.Text(ical.PropUID)
+		if err != nil {
+			uid = fmt.Sprintf("__no_uid_%d", i)
+		}
+
+		g, ok := groups[uid]
+		if !ok {
+			g = &group{}
+			groups[uid] = g
+			order = append(order, uid)
+		}
+
+		if recurrenceId := event.Props.Get(ical.PropRecurrenceID); recurrenceId != nil {
+			g.overrides = append(g.overrides, event)
+		} else {
+			g.master = &icalEvents[i]
+		}
+	}
+
+	calendarEvents := make([]models.CalendarEvent, 0)
+	for _, uid := range order {
+		g := groups[uid]
+		if g.master == nil {
+			// Orphan RECURRENCE-ID overrides with no master are treated as standalone events
+			for _, override := range g.overrides {
+				calendarEvent, err := calendarEventFromVEVENT(override)
+				if err != nil {
+					continue
+				}
+				if calendarEvent.StartDate.Time().Before(timeMax) && calendarEvent.EndDate.Time().After(timeMin) {
+					calendarEvents = append(calendarEvents, calendarEvent)
+				}
+			}
+			continue
+		}
+
+		events, err := expandGroup(*g.master, g.overrides, timeMin, timeMax)
+		if err != nil {
+			return nil, err
+		}
+		calendarEvents = append(calendarEvents, events...)
+	}
+
+	return calendarEvents, nil
+}
+
+// expandGroup expands a single master VEVENT (with any overrides) into occurrences
+func expandGroup(master ical.Event, overrideEvents []ical.Event, timeMin time.Time, timeMax time.Time) ([]models.CalendarEvent, error) {
+	baseEvent, err := calendarEventFromVEVENT(master)
+	if err != nil {
+		return nil, err
+	}
+
+	location := time.UTC
+	if start := master.Props.Get(ical.PropDateTimeStart); start != nil {
+		if t, err := start.DateTime(time.UTC); err == nil {
+			location = t.Location()
+		}
+	}
+
+	rdates := make([]time.Time, 0)
+	for _, rdateProp := range master.Props.Values(ical.PropRecurrenceDates) {
+		if t, err := rdateProp.DateTime(location); err == nil {
+			rdates = append(rdates, t)
+		}
+	}
+
+	ruleProp := master.Props.Get(ical.PropRecurrenceRule)
+	if ruleProp == nil && len(rdates) == 0 {
+		// Not a recurring event - just return the single occurrence if it's in range
+		if baseEvent.StartDate.Time().Before(timeMax) && baseEvent.EndDate.Time().After(timeMin) {
+			return []models.CalendarEvent{baseEvent}, nil
+		}
+		return []models.CalendarEvent{}, nil
+	}
+
+	exdates := make([]time.Time, 0)
+	for _, exdateProp := range master.Props.Values(ical.PropExceptionDates) {
+		if t, err := exdateProp.DateTime(location); err == nil {
+			exdates = append(exdates, t)
+		}
+	}
+
+	overrides := make([]recurrence.Override, 0, len(overrideEvents))
+	for _, overrideVEVENT := range overrideEvents {
+		recurrenceIdProp := overrideVEVENT.Props.Get(ical.PropRecurrenceID)
+		recurrenceId, err := recurrenceIdProp.DateTime(location)
+		if err != nil {
+			continue
+		}
+		overrideEvent, err := calendarEventFromVEVENT(overrideVEVENT)
+		if err != nil {
+			continue
+		}
+		overrides = append(overrides, recurrence.Override{RecurrenceId: recurrenceId, Event: overrideEvent})
+	}
+
+	rule := ""
+	if ruleProp != nil {
+		rule = ruleProp.Value
+	}
+
+	return recurrence.Expand(baseEvent, rule, rdates, exdates, overrides, timeMin, timeMax, location)
+}
+
+// calendarEventFromVEVENT converts a parsed VEVENT into a models.CalendarEvent
+func calendarEventFromVEVENT(event ical.Event) (models.CalendarEvent, error) {
+	summary, err := event.Props.Text(ical.PropSummary)
+	if err != nil {
+		summary = ""
+	}
+
+	start, err := event.DateTimeStart(time.UTC)
+	if err != nil {
+		return models.CalendarEvent{}, fmt.Errorf("caldav: missing DTSTART: %w", err)
+	}
+	end, err := event.DateTimeEnd(time.UTC)
+	if err != nil {
+		return models.CalendarEvent{}, fmt.Errorf("caldav: missing DTEND: %w", err)
+	}
+
+	return models.CalendarEvent{
+		Summary:   summary,
+		StartDate: primitive.NewDateTimeFromTime(start),
+		EndDate:   primitive.NewDateTimeFromTime(end),
+	}, nil
+}
+
+// Watch has no real effect for CalDAV, which has no standardized push mechanism. It only
+// hands back a locally-generated channel id so the caller can store a subscription record;
+// jobs.PollCalDAVSubscriptions polls GetCTag instead to detect changes until expiry.
+// channelToken is accepted only to satisfy CalendarProvider; CalDAV never echoes it back.
+func (c *CalDAVCalendar) Watch(calendarId string, callbackURL string, channelToken string, ttl time.Duration) (channelId string, resourceId string, expiry time.Time, err error) {
+	return uuid.NewString(), calendarId, time.Now().Add(ttl), nil
+}
+
+// StopWatch is a no-op for CalDAV since Watch never registered anything with the server
+func (c *CalDAVCalendar) StopWatch(channelId string, resourceId string) error {
+	return nil
+}
+
+// GetCTag returns the CalDAV collection's getctag, which changes whenever any event in the
+// collection is added, modified, or removed. Polling this is cheaper than re-running a full
+// calendar-query REPORT on every tick.
+func (c *CalDAVCalendar) GetCTag(calendarId string) (string, error) {
+	res, err := c.propfind(c.resolve(calendarId), "0", `<?xml version="1.0" encoding="utf-8"?>
+<D:propfind xmlns:D="DAV:" xmlns:CS="http://calendarserver.org/ns/">
+  <D:prop><CS:getctag/></D:prop>
+</D:propfind>`)
+	if err != nil {
+		return "", fmt.Errorf("caldav: fetching getctag for %s: %w", calendarId, err)
+	}
+	if len(res.Responses) == 0 {
+		return "", fmt.Errorf("caldav: no response for getctag on %s", calendarId)
+	}
+	return res.Responses[0].PropStat.Prop.GetCTag, nil
+}
@@ -0,0 +1,185 @@
+package calendar
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"schej.it/server/models"
+)
+
+// GoogleCalendar implements CalendarProvider for a user's Google account
+type GoogleCalendar struct {
+	models.GoogleCalendarAuth
+}
+
+func (g *GoogleCalendar) authedRequest(method string, url string, body io.Reader) (*http.Response, error) {
+	req, err := http.NewRequest(method, url, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", g.AccessToken))
+	req.Header.Set("Content-Type", "application/json")
+
+	return http.DefaultClient.Do(req)
+}
+
+// GetCalendarList returns the calendars on the user's Google account
+func (g *GoogleCalendar) GetCalendarList() (map[string]models.SubCalendar, error) {
+	resp, err := g.authedRequest("GET", "https://www.googleapis.com/calendar/v3/users/me/calendarList", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var res struct {
+		Items []struct {
+			Id              string `json:"id"`
+			Summary         string `json:"summary"`
+			BackgroundColor string `json:"backgroundColor"`
+			Selected        bool   `json:"selected"`
+		} `json:"items"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		return nil, err
+	}
+
+	subCalendars := make(map[string]models.SubCalendar, len(res.Items))
+	for _, item := range res.Items {
+		selected := item.Selected
+		subCalendars[item.Id] = models.SubCalendar{
+			Id:      item.Id,
+			Name:    item.Summary,
+			Color:   item.BackgroundColor,
+			Enabled: &selected,
+		}
+	}
+
+	return subCalendars, nil
+}
+
+// GetCalendarEvents returns the user's events on calendarId between timeMin and timeMax
+func (g *GoogleCalendar) GetCalendarEvents(calendarId string, timeMin time.Time, timeMax time.Time) ([]models.CalendarEvent, error) {
+	min, _ := timeMin.MarshalText()
+	max, _ := timeMax.MarshalText()
+	url := fmt.Sprintf(
+		"https://www.googleapis.com/calendar/v3/calendars/%s/events?timeMin=%s&timeMax=%s&singleEvents=true",
+		calendarId, min, max,
+	)
+
+	resp, err := g.authedRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	type timeInfo struct {
+		DateTime time.Time `json:"dateTime"`
+	}
+	var res struct {
+		Items []struct {
+			Summary string   `json:"summary"`
+			Start   timeInfo `json:"start"`
+			End     timeInfo `json:"end"`
+		} `json:"items"`
+		Error interface{} `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		return nil, err
+	}
+	if res.Error != nil {
+		return nil, fmt.Errorf("google: error fetching events for %s: %v", calendarId, res.Error)
+	}
+
+	calendarEvents := make([]models.CalendarEvent, 0, len(res.Items))
+	for _, item := range res.Items {
+		calendarEvents = append(calendarEvents, models.CalendarEvent{
+			Summary:   item.Summary,
+			StartDate: primitive.NewDateTimeFromTime(item.Start.DateTime),
+			EndDate:   primitive.NewDateTimeFromTime(item.End.DateTime),
+		})
+	}
+
+	return calendarEvents, nil
+}
+
+// Watch registers a push notification channel via POST /calendars/{id}/events/watch
+func (g *GoogleCalendar) Watch(calendarId string, callbackURL string, channelToken string, ttl time.Duration) (channelId string, resourceId string, expiry time.Time, err error) {
+	channelId = uuid.NewString()
+	body, err := json.Marshal(map[string]interface{}{
+		"id":         channelId,
+		"type":       "web_hook",
+		"address":    callbackURL,
+		"token":      channelToken,
+		"expiration": fmt.Sprintf("%d", time.Now().Add(ttl).UnixMilli()),
+	})
+	if err != nil {
+		return "", "", time.Time{}, err
+	}
+
+	url := fmt.Sprintf("https://www.googleapis.com/calendar/v3/calendars/%s/events/watch", calendarId)
+	resp, err := g.authedRequest("POST", url, bytes.NewReader(body))
+	if err != nil {
+		return "", "", time.Time{}, err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", "", time.Time{}, err
+	}
+	if resp.StatusCode >= 300 {
+		return "", "", time.Time{}, fmt.Errorf("google: watch request for %s failed: %s", calendarId, respBody)
+	}
+
+	var res struct {
+		ResourceId string `json:"resourceId"`
+		Expiration string `json:"expiration"`
+	}
+	if err := json.Unmarshal(respBody, &res); err != nil {
+		return "", "", time.Time{}, err
+	}
+	if res.ResourceId == "" {
+		return "", "", time.Time{}, fmt.Errorf("google: watch request for %s failed: %s", calendarId, respBody)
+	}
+
+	expiryMillis, err := parseExpiration(res.Expiration)
+	if err != nil {
+		expiryMillis = time.Now().Add(ttl)
+	}
+
+	return channelId, res.ResourceId, expiryMillis, nil
+}
+
+// StopWatch cancels a push notification channel via POST /channels/stop
+func (g *GoogleCalendar) StopWatch(channelId string, resourceId string) error {
+	body, err := json.Marshal(map[string]interface{}{"id": channelId, "resourceId": resourceId})
+	if err != nil {
+		return err
+	}
+
+	resp, err := g.authedRequest("POST", "https://www.googleapis.com/calendar/v3/channels/stop", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		respBody, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("google: stopping channel %s failed: %s", channelId, respBody)
+	}
+	return nil
+}
+
+func parseExpiration(expirationMillis string) (time.Time, error) {
+	var millis int64
+	if _, err := fmt.Sscanf(expirationMillis, "%d", &millis); err != nil {
+		return time.Time{}, err
+	}
+	return time.UnixMilli(millis), nil
+}
@@ -0,0 +1,92 @@
+// Package recurrence expands a recurring calendar event (RRULE/RDATE/EXDATE) into
+// concrete occurrences. It exists because only some calendar providers (Google) expand
+// recurring events for us server-side; others (Apple/CalDAV) return the raw VEVENT and
+// expect the client to do the expansion.
+package recurrence
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/teambition/rrule-go"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"schej.it/server/models"
+)
+
+// Override represents a RECURRENCE-ID VEVENT that replaces the occurrence it matches
+type Override struct {
+	RecurrenceId time.Time
+	Event        models.CalendarEvent
+}
+
+// Expand returns the concrete occurrences of base that fall within [timeMin, timeMax].
+//
+// rule is the RFC 5545 RRULE value (e.g. "FREQ=WEEKLY;BYDAY=MO,WE,FR"), or "" if the event
+// has none. rdates are extra occurrence start times added via RDATE - if rule is "" these
+// are the only recurrences (besides base's own start time); if rule is set they supplement
+// the rule's occurrences, same as a real calendar client would layer them. exdates are the
+// start times excluded via EXDATE (applied whether or not there's an RRULE). overrides are
+// keyed by the RECURRENCE-ID they replace. location is the event's original TZID; expansion
+// happens in that zone so DST transitions shift occurrences the same way a real calendar
+// client would, and results are converted to UTC afterwards.
+func Expand(base models.CalendarEvent, rule string, rdates []time.Time, exdates []time.Time, overrides []Override, timeMin time.Time, timeMax time.Time, location *time.Location) ([]models.CalendarEvent, error) {
+	start := base.StartDate.Time()
+	duration := base.EndDate.Time().Sub(start)
+
+	excluded := make(map[int64]bool, len(exdates))
+	for _, exdate := range exdates {
+		excluded[exdate.In(location).Unix()] = true
+	}
+
+	overrideByStart := make(map[int64]models.CalendarEvent, len(overrides))
+	for _, override := range overrides {
+		overrideByStart[override.RecurrenceId.In(location).Unix()] = override.Event
+	}
+
+	var occurrences []time.Time
+	if rule != "" {
+		r, err := rrule.StrToRRule(rule)
+		if err != nil {
+			return nil, fmt.Errorf("recurrence: parsing rrule %q: %w", rule, err)
+		}
+		r.DTStart(start.In(location))
+
+		set := rrule.Set{}
+		set.RRule(r)
+		for _, rdate := range rdates {
+			set.RDate(rdate.In(location))
+		}
+		occurrences = set.Between(timeMin.In(location), timeMax.In(location), true)
+	} else {
+		// RDATE-only recurrence: there's no RRULE to ask for occurrences in range, so build
+		// the candidate list ourselves (base's own start time plus every RDATE) and filter it
+		occurrences = make([]time.Time, 0, len(rdates)+1)
+		for _, occurrence := range append([]time.Time{start}, rdates...) {
+			occurrence = occurrence.In(location)
+			if !occurrence.Before(timeMin.In(location)) && !occurrence.After(timeMax.In(location)) {
+				occurrences = append(occurrences, occurrence)
+			}
+		}
+	}
+
+	events := make([]models.CalendarEvent, 0, len(occurrences))
+	for _, occurrence := range occurrences {
+		key := occurrence.Unix()
+		if excluded[key] {
+			continue
+		}
+		if override, ok := overrideByStart[key]; ok {
+			events = append(events, override)
+			continue
+		}
+
+		occurrenceStart := occurrence.UTC()
+		events = append(events, models.CalendarEvent{
+			Summary:   base.Summary,
+			StartDate: primitive.NewDateTimeFromTime(occurrenceStart),
+			EndDate:   primitive.NewDateTimeFromTime(occurrenceStart.Add(duration)),
+		})
+	}
+
+	return events, nil
+}
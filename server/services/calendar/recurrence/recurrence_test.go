@@ -0,0 +1,182 @@
+package recurrence
+
+import (
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"schej.it/server/models"
+)
+
+func newBase(t *testing.T, start time.Time, duration time.Duration) models.CalendarEvent {
+	t.Helper()
+	return models.CalendarEvent{
+		Summary:   "Standup",
+		StartDate: primitive.NewDateTimeFromTime(start),
+		EndDate:   primitive.NewDateTimeFromTime(start.Add(duration)),
+	}
+}
+
+func starts(t *testing.T, events []models.CalendarEvent) []time.Time {
+	t.Helper()
+	times := make([]time.Time, len(events))
+	for i, event := range events {
+		times[i] = event.StartDate.Time()
+	}
+	return times
+}
+
+func assertStarts(t *testing.T, got []models.CalendarEvent, want []time.Time) {
+	t.Helper()
+	gotStarts := starts(t, got)
+	if len(gotStarts) != len(want) {
+		t.Fatalf("got %d occurrences %v, want %d %v", len(gotStarts), gotStarts, len(want), want)
+	}
+	for i, w := range want {
+		if !gotStarts[i].Equal(w) {
+			t.Errorf("occurrence %d = %v, want %v", i, gotStarts[i], w)
+		}
+	}
+}
+
+func TestExpand_RRuleOnly(t *testing.T) {
+	start := time.Date(2026, 1, 5, 9, 0, 0, 0, time.UTC) // a Monday
+	base := newBase(t, start, time.Hour)
+
+	events, err := Expand(base, "FREQ=WEEKLY;COUNT=3", nil, nil, nil,
+		time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC),
+		time.Date(2026, 2, 1, 0, 0, 0, 0, time.UTC),
+		time.UTC,
+	)
+	if err != nil {
+		t.Fatalf("Expand: %v", err)
+	}
+
+	assertStarts(t, events, []time.Time{
+		start,
+		start.AddDate(0, 0, 7),
+		start.AddDate(0, 0, 14),
+	})
+}
+
+func TestExpand_RDateOnly(t *testing.T) {
+	start := time.Date(2026, 1, 5, 9, 0, 0, 0, time.UTC)
+	rdate1 := time.Date(2026, 1, 9, 9, 0, 0, 0, time.UTC)
+	rdate2 := time.Date(2026, 1, 20, 9, 0, 0, 0, time.UTC)
+	base := newBase(t, start, time.Hour)
+
+	// No RRULE - the event's other instances must come purely from RDATE instead of the
+	// event silently being treated as a single non-recurring occurrence
+	events, err := Expand(base, "", []time.Time{rdate1, rdate2}, nil, nil,
+		time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC),
+		time.Date(2026, 2, 1, 0, 0, 0, 0, time.UTC),
+		time.UTC,
+	)
+	if err != nil {
+		t.Fatalf("Expand: %v", err)
+	}
+
+	assertStarts(t, events, []time.Time{start, rdate1, rdate2})
+}
+
+func TestExpand_RRulePlusRDate(t *testing.T) {
+	start := time.Date(2026, 1, 5, 9, 0, 0, 0, time.UTC)   // Monday
+	extra := time.Date(2026, 1, 16, 14, 0, 0, 0, time.UTC) // an ad-hoc Friday instance
+	base := newBase(t, start, time.Hour)
+
+	events, err := Expand(base, "FREQ=WEEKLY;COUNT=3", []time.Time{extra}, nil, nil,
+		time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC),
+		time.Date(2026, 2, 1, 0, 0, 0, 0, time.UTC),
+		time.UTC,
+	)
+	if err != nil {
+		t.Fatalf("Expand: %v", err)
+	}
+
+	assertStarts(t, events, []time.Time{
+		start,
+		start.AddDate(0, 0, 7),
+		extra,
+		start.AddDate(0, 0, 14),
+	})
+}
+
+func TestExpand_ExDateDropsOccurrence(t *testing.T) {
+	start := time.Date(2026, 1, 5, 9, 0, 0, 0, time.UTC)
+	excluded := start.AddDate(0, 0, 7)
+	base := newBase(t, start, time.Hour)
+
+	events, err := Expand(base, "FREQ=WEEKLY;COUNT=3", nil, []time.Time{excluded}, nil,
+		time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC),
+		time.Date(2026, 2, 1, 0, 0, 0, 0, time.UTC),
+		time.UTC,
+	)
+	if err != nil {
+		t.Fatalf("Expand: %v", err)
+	}
+
+	assertStarts(t, events, []time.Time{start, start.AddDate(0, 0, 14)})
+}
+
+func TestExpand_OverrideReplacesOccurrence(t *testing.T) {
+	start := time.Date(2026, 1, 5, 9, 0, 0, 0, time.UTC)
+	recurrenceId := start.AddDate(0, 0, 7)
+	rescheduled := recurrenceId.Add(3 * time.Hour)
+	base := newBase(t, start, time.Hour)
+
+	override := Override{
+		RecurrenceId: recurrenceId,
+		Event: models.CalendarEvent{
+			Summary:   "Standup (rescheduled)",
+			StartDate: primitive.NewDateTimeFromTime(rescheduled),
+			EndDate:   primitive.NewDateTimeFromTime(rescheduled.Add(time.Hour)),
+		},
+	}
+
+	events, err := Expand(base, "FREQ=WEEKLY;COUNT=3", nil, nil, []Override{override},
+		time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC),
+		time.Date(2026, 2, 1, 0, 0, 0, 0, time.UTC),
+		time.UTC,
+	)
+	if err != nil {
+		t.Fatalf("Expand: %v", err)
+	}
+
+	assertStarts(t, events, []time.Time{start, rescheduled, start.AddDate(0, 0, 14)})
+	if events[1].Summary != "Standup (rescheduled)" {
+		t.Errorf("events[1].Summary = %q, want the override's summary", events[1].Summary)
+	}
+}
+
+func TestExpand_DSTTransitionKeepsLocalTime(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skipf("America/New_York tzdata unavailable: %v", err)
+	}
+
+	// 9am Eastern, one week before the US "spring forward" DST transition in 2026 (March 8)
+	start := time.Date(2026, 3, 1, 9, 0, 0, 0, newYork)
+	base := newBase(t, start, time.Hour)
+
+	events, err := Expand(base, "FREQ=WEEKLY;COUNT=2", nil, nil, nil,
+		time.Date(2026, 2, 1, 0, 0, 0, 0, time.UTC),
+		time.Date(2026, 4, 1, 0, 0, 0, 0, time.UTC),
+		newYork,
+	)
+	if err != nil {
+		t.Fatalf("Expand: %v", err)
+	}
+	if len(events) != 2 {
+		t.Fatalf("got %d occurrences, want 2", len(events))
+	}
+
+	// Both occurrences should read as 9am Eastern, even though the second one falls after
+	// the clocks spring forward (EST -> EDT) - a naive UTC-offset expansion would drift by
+	// an hour instead of preserving the wall-clock time.
+	for i, event := range events {
+		localStart := event.StartDate.Time().In(newYork)
+		if localStart.Hour() != 9 {
+			t.Errorf("occurrence %d local hour = %d, want 9 (local time = %v)", i, localStart.Hour(), localStart)
+		}
+	}
+}
@@ -9,6 +9,26 @@ import (
 type CalendarProvider interface {
 	GetCalendarList() (map[string]models.SubCalendar, error)
 	GetCalendarEvents(calendarId string, timeMin time.Time, timeMax time.Time) ([]models.CalendarEvent, error)
+
+	// Watch registers a subscription for changes to calendarId, calling back to callbackURL
+	// when they occur (or, if the provider has no push support, marking the subscription for
+	// periodic polling instead). channelToken is a caller-generated secret the provider should
+	// echo back on every notification so the webhook handler can verify it; it's the caller's
+	// responsibility to persist it alongside the returned channel/resource ids. Watch returns
+	// those ids (used to identify the subscription to the provider) and the time at which the
+	// subscription must be renewed.
+	Watch(calendarId string, callbackURL string, channelToken string, ttl time.Duration) (channelId string, resourceId string, expiry time.Time, err error)
+
+	// StopWatch cancels a subscription previously created by Watch
+	StopWatch(channelId string, resourceId string) error
+}
+
+// CTagPoller is implemented by providers that have no push support and must instead be
+// polled for changes. jobs.PollCalDAVSubscriptions type-asserts a CalendarProvider against
+// this interface to find subscriptions it needs to poll this way.
+type CTagPoller interface {
+	// GetCTag returns an opaque value that changes whenever any event in calendarId changes
+	GetCTag(calendarId string) (string, error)
 }
 
 func GetCalendarProvider(calendarAccount models.CalendarAccount) CalendarProvider {
@@ -21,6 +41,10 @@ func GetCalendarProvider(calendarAccount models.CalendarAccount) CalendarProvide
 		return &AppleCalendar{
 			AppleCalendarAuth: *calendarAccount.AppleCalendarAuth,
 		}
+	case models.CalDAVCalendarType:
+		return &CalDAVCalendar{
+			CalDAVCalendarAuth: *calendarAccount.CalDAVCalendarAuth,
+		}
 	}
 	return nil
 }
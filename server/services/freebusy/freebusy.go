@@ -0,0 +1,108 @@
+// Package freebusy merges and intersects busy/free time blocks gathered from one or more
+// calendar providers, independent of which provider they came from.
+package freebusy
+
+import (
+	"sort"
+	"time"
+)
+
+// Block is a closed time interval, used both for busy blocks (time a calendar is occupied)
+// and free blocks (the complement of busy within some window)
+type Block struct {
+	Start time.Time
+	End   time.Time
+}
+
+// Merge sorts blocks and collapses any that overlap or touch into a single block
+func Merge(blocks []Block) []Block {
+	if len(blocks) == 0 {
+		return []Block{}
+	}
+
+	sorted := make([]Block, len(blocks))
+	copy(sorted, blocks)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Start.Before(sorted[j].Start) })
+
+	merged := []Block{sorted[0]}
+	for _, block := range sorted[1:] {
+		last := &merged[len(merged)-1]
+		if block.Start.After(last.End) {
+			merged = append(merged, block)
+			continue
+		}
+		if block.End.After(last.End) {
+			last.End = block.End
+		}
+	}
+
+	return merged
+}
+
+// Invert returns the free blocks within [windowStart, windowEnd] given a set of (merged)
+// busy blocks
+func Invert(busy []Block, windowStart time.Time, windowEnd time.Time) []Block {
+	free := make([]Block, 0)
+	cursor := windowStart
+
+	for _, block := range Merge(busy) {
+		if block.Start.After(cursor) {
+			free = append(free, Block{Start: cursor, End: block.Start})
+		}
+		if block.End.After(cursor) {
+			cursor = block.End
+		}
+	}
+
+	if windowEnd.After(cursor) {
+		free = append(free, Block{Start: cursor, End: windowEnd})
+	}
+
+	return free
+}
+
+// Intersect returns the blocks of time present in every one of the given free-block sets,
+// i.e. the windows where all of them are simultaneously free
+func Intersect(freeSets [][]Block) []Block {
+	if len(freeSets) == 0 {
+		return []Block{}
+	}
+
+	result := freeSets[0]
+	for _, free := range freeSets[1:] {
+		result = intersectPair(result, free)
+		if len(result) == 0 {
+			break
+		}
+	}
+
+	return result
+}
+
+func intersectPair(a []Block, b []Block) []Block {
+	result := make([]Block, 0)
+	i, j := 0, 0
+
+	for i < len(a) && j < len(b) {
+		start := a[i].Start
+		if b[j].Start.After(start) {
+			start = b[j].Start
+		}
+		end := a[i].End
+		if b[j].End.Before(end) {
+			end = b[j].End
+		}
+
+		if start.Before(end) {
+			result = append(result, Block{Start: start, End: end})
+		}
+
+		if a[i].End.Before(b[j].End) {
+			i++
+		} else {
+			j++
+		}
+	}
+
+	return result
+}
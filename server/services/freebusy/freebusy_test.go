@@ -0,0 +1,100 @@
+package freebusy
+
+import (
+	"testing"
+	"time"
+)
+
+func t0(hour int) time.Time {
+	return time.Date(2026, 1, 5, hour, 0, 0, 0, time.UTC)
+}
+
+func assertBlocks(t *testing.T, got []Block, want []Block) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("got %d blocks %v, want %d %v", len(got), got, len(want), want)
+	}
+	for i, w := range want {
+		if !got[i].Start.Equal(w.Start) || !got[i].End.Equal(w.End) {
+			t.Errorf("block %d = %v, want %v", i, got[i], w)
+		}
+	}
+}
+
+func TestMerge_OverlappingAndTouchingBlocksCollapse(t *testing.T) {
+	got := Merge([]Block{
+		{Start: t0(10), End: t0(11)},
+		{Start: t0(9), End: t0(10)},  // touches the block above
+		{Start: t0(14), End: t0(15)}, // disjoint
+		{Start: t0(12), End: t0(13)}, // disjoint, sorts between the two groups
+	})
+
+	assertBlocks(t, got, []Block{
+		{Start: t0(9), End: t0(11)},
+		{Start: t0(12), End: t0(13)},
+		{Start: t0(14), End: t0(15)},
+	})
+}
+
+func TestMerge_Empty(t *testing.T) {
+	got := Merge(nil)
+	if len(got) != 0 {
+		t.Errorf("Merge(nil) = %v, want empty", got)
+	}
+}
+
+func TestInvert_SplitsWindowAroundBusyBlocks(t *testing.T) {
+	busy := []Block{
+		{Start: t0(10), End: t0(11)},
+		{Start: t0(13), End: t0(14)},
+	}
+
+	got := Invert(busy, t0(9), t0(15))
+
+	assertBlocks(t, got, []Block{
+		{Start: t0(9), End: t0(10)},
+		{Start: t0(11), End: t0(13)},
+		{Start: t0(14), End: t0(15)},
+	})
+}
+
+func TestInvert_FullyBusyWindowYieldsNoFreeBlocks(t *testing.T) {
+	busy := []Block{{Start: t0(9), End: t0(15)}}
+
+	got := Invert(busy, t0(9), t0(15))
+	if len(got) != 0 {
+		t.Errorf("Invert of a fully busy window = %v, want empty", got)
+	}
+}
+
+func TestInvert_NoBusyBlocksYieldsWholeWindow(t *testing.T) {
+	got := Invert(nil, t0(9), t0(15))
+	assertBlocks(t, got, []Block{{Start: t0(9), End: t0(15)}})
+}
+
+func TestIntersect_OnlyOverlapOfAllSetsSurvives(t *testing.T) {
+	a := []Block{{Start: t0(9), End: t0(12)}}
+	b := []Block{{Start: t0(10), End: t0(14)}}
+	c := []Block{{Start: t0(11), End: t0(13)}}
+
+	got := Intersect([][]Block{a, b, c})
+
+	assertBlocks(t, got, []Block{{Start: t0(11), End: t0(12)}})
+}
+
+func TestIntersect_NonOverlappingSetsYieldNothing(t *testing.T) {
+	a := []Block{{Start: t0(9), End: t0(10)}}
+	b := []Block{{Start: t0(11), End: t0(12)}}
+
+	got := Intersect([][]Block{a, b})
+	if len(got) != 0 {
+		t.Errorf("Intersect of disjoint sets = %v, want empty", got)
+	}
+}
+
+func TestIntersect_NoSetsYieldsEmpty(t *testing.T) {
+	got := Intersect(nil)
+	if len(got) != 0 {
+		t.Errorf("Intersect(nil) = %v, want empty", got)
+	}
+}
@@ -3,6 +3,7 @@ package utils
 import (
 	"encoding/json"
 	"fmt"
+	"os"
 
 	"github.com/brianvoe/sjwt"
 	"github.com/gin-contrib/sessions"
@@ -37,3 +38,33 @@ func GetUserId(session sessions.Session) primitive.ObjectID {
 
 	return objectID
 }
+
+// GenerateEventICSToken creates a signed token granting access to an event's calendar.ics
+// feed without a session, so calendar apps can subscribe to it via webcal://
+func GenerateEventICSToken(eventId string) string {
+	claims := sjwt.New()
+	claims.Set("eventId", eventId)
+
+	token, err := claims.Generate([]byte(os.Getenv("ICS_TOKEN_SECRET")))
+	if err != nil {
+		panic(err)
+	}
+
+	return token
+}
+
+// VerifyEventICSToken checks that token was produced by GenerateEventICSToken for eventId
+func VerifyEventICSToken(token string, eventId string) bool {
+	secret := []byte(os.Getenv("ICS_TOKEN_SECRET"))
+	if err := sjwt.Verify(token, secret); err != nil {
+		return false
+	}
+
+	claims, err := sjwt.Parse(token)
+	if err != nil {
+		return false
+	}
+
+	tokenEventId, err := claims.GetStr("eventId")
+	return err == nil && tokenEventId == eventId
+}